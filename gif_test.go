@@ -1,13 +1,18 @@
-package gifp
+package gip
 
 import (
 	"bytes"
 	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
 	"image/gif"
 	"image/png"
 	"os"
 	"testing"
 	"time"
+
+	"golang.org/x/image/draw"
 )
 
 func TestSpeedComparison(t *testing.T) {
@@ -63,6 +68,296 @@ func TestSpeedComparison(t *testing.T) {
 	fmt.Printf("- test_fast.gif (our fast encoder)\n")
 }
 
+func TestEncodeAllAnimated(t *testing.T) {
+	pm1 := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.WebSafe)
+	pm2 := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.WebSafe)
+	for i := range pm1.Pix {
+		pm1.Pix[i] = 1
+		pm2.Pix[i] = 2
+	}
+
+	g := &GIF{
+		Image:    []*image.Paletted{pm1, pm2},
+		Delay:    []int{10, 20},
+		Disposal: []byte{DisposalNone, DisposalNone},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	decoded, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("standard library failed to decode our animated GIF: %v", err)
+	}
+
+	if len(decoded.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(decoded.Image))
+	}
+	if decoded.Delay[0] != 10 || decoded.Delay[1] != 20 {
+		t.Errorf("delays = %v, want [10 20]", decoded.Delay)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if got := decoded.Image[0].ColorIndexAt(x, y); got != 1 {
+				t.Fatalf("frame0 pixel (%d,%d) = %d, want 1", x, y, got)
+			}
+			if got := decoded.Image[1].ColorIndexAt(x, y); got != 2 {
+				t.Fatalf("frame1 pixel (%d,%d) = %d, want 2", x, y, got)
+			}
+		}
+	}
+}
+
+func TestEncodeAllTransparentDiff(t *testing.T) {
+	pal := palette.WebSafe
+	transparent := uint8(216)
+
+	pm1 := image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+	for i := range pm1.Pix {
+		pm1.Pix[i] = 1
+	}
+
+	pm2 := image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+	copy(pm2.Pix, pm1.Pix)
+	pm2.SetColorIndex(1, 1, 2)
+
+	g := &GIF{
+		Image:       []*image.Paletted{pm1, pm2},
+		Delay:       []int{10, 10},
+		Disposal:    []byte{DisposalNone, DisposalNone},
+		Transparent: &transparent,
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	decoded, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("standard library failed to decode our animated GIF: %v", err)
+	}
+	if len(decoded.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(decoded.Image))
+	}
+
+	second := decoded.Image[1]
+	if b := second.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Errorf("second frame bounds = %v, want a 1x1 rect around the changed pixel", b)
+	}
+	if got := second.ColorIndexAt(1, 1); got != 2 {
+		t.Errorf("changed pixel (1,1) = %d, want 2", got)
+	}
+}
+
+func TestLZWRoundTripLargeImage(t *testing.T) {
+	// Large and varied enough to fill the 4096-entry LZW table and force
+	// an in-stream clear code reset, exercising the parallel pipeline's
+	// single-stream guarantee rather than just a handful of pixels.
+	pm := image.NewPaletted(image.Rect(0, 0, 300, 300), palette.WebSafe)
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			pm.SetColorIndex(x, y, uint8((x*7+y*13+x*y)%216))
+		}
+	}
+
+	var buf bytes.Buffer
+	g := &GIF{Image: []*image.Paletted{pm}, Delay: []int{0}, Disposal: []byte{DisposalNone}}
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	decoded, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("standard library failed to decode: %v", err)
+	}
+
+	pd, ok := decoded.(*image.Paletted)
+	if !ok {
+		t.Fatalf("decoded image is %T, want *image.Paletted", decoded)
+	}
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			if want, got := pm.ColorIndexAt(x, y), pd.ColorIndexAt(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeWithQuantizerAndDrawer(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 32), uint8(y * 32), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	o := &Options{Quantizer: MedianCutQuantizer{}, Drawer: draw.FloydSteinberg}
+	if err := Encode(&buf, src, o); err != nil {
+		t.Fatalf("Encode with quantizer/drawer failed: %v", err)
+	}
+
+	img, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("standard library failed to decode our GIF: %v", err)
+	}
+	if got := img.Bounds(); got != src.Bounds() {
+		t.Errorf("bounds = %v, want %v", got, src.Bounds())
+	}
+}
+
+func TestEncodeWithQuantizerUniformImage(t *testing.T) {
+	// A solid-color source gives MedianCutQuantizer a single distinct
+	// color, so the quantized palette has exactly 1 entry: the degenerate
+	// case that exposed a color-table-size desync in paddedPaletteSize.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.Set(x, y, color.RGBA{10, 20, 30, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	o := &Options{Quantizer: MedianCutQuantizer{}}
+	if err := Encode(&buf, src, o); err != nil {
+		t.Fatalf("Encode with a 1-color palette failed: %v", err)
+	}
+
+	img, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("standard library failed to decode our GIF: %v", err)
+	}
+	if got := img.Bounds(); got != src.Bounds() {
+		t.Errorf("bounds = %v, want %v", got, src.Bounds())
+	}
+}
+
+func TestDecodeAllRoundTrip(t *testing.T) {
+	pal := palette.WebSafe
+	transparent := uint8(216)
+
+	pm1 := image.NewPaletted(image.Rect(0, 0, 6, 6), pal)
+	for i := range pm1.Pix {
+		pm1.Pix[i] = 1
+	}
+	pm2 := image.NewPaletted(image.Rect(0, 0, 6, 6), pal)
+	copy(pm2.Pix, pm1.Pix)
+	pm2.SetColorIndex(2, 3, 5)
+
+	g := &GIF{
+		Image:       []*image.Paletted{pm1, pm2},
+		Delay:       []int{10, 20},
+		Disposal:    []byte{DisposalNone, DisposalNone},
+		LoopCount:   7,
+		Transparent: &transparent,
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	decoded, err := DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("DecodeAll failed: %v", err)
+	}
+	if len(decoded.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(decoded.Image))
+	}
+	if decoded.Delay[0] != 10 || decoded.Delay[1] != 20 {
+		t.Errorf("delays = %v, want [10 20]", decoded.Delay)
+	}
+	if decoded.LoopCount != 7 {
+		t.Errorf("loop count = %d, want 7", decoded.LoopCount)
+	}
+
+	want, err := gif.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("standard library failed to decode our animated GIF: %v", err)
+	}
+	for i := range want.Image {
+		wb, gb := want.Image[i].Bounds(), decoded.Image[i].Bounds()
+		if wb != gb {
+			t.Fatalf("frame %d bounds = %v, want %v", i, gb, wb)
+		}
+		for y := wb.Min.Y; y < wb.Max.Y; y++ {
+			for x := wb.Min.X; x < wb.Max.X; x++ {
+				wr, wg2, wbl, wa := want.Image[i].At(x, y).RGBA()
+				gr, gg, gbl, ga := decoded.Image[i].At(x, y).RGBA()
+				if wr != gr || wg2 != gg || wbl != gbl || wa != ga {
+					t.Fatalf("frame %d pixel (%d,%d) = %v, want %v", i, x, y, []uint32{gr, gg, gbl, ga}, []uint32{wr, wg2, wbl, wa})
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 10, 20), palette.WebSafe)
+	g := &GIF{Image: []*image.Paletted{pm}, Delay: []int{0}, Disposal: []byte{DisposalNone}}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	cfg, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("DecodeConfig failed: %v", err)
+	}
+	if cfg.Width != 10 || cfg.Height != 20 {
+		t.Errorf("config = %dx%d, want 10x20", cfg.Width, cfg.Height)
+	}
+}
+
+func TestEncodeInterlaced(t *testing.T) {
+	pm := image.NewPaletted(image.Rect(0, 0, 10, 17), palette.WebSafe)
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 10; x++ {
+			pm.SetColorIndex(x, y, uint8((x+y)%216))
+		}
+	}
+
+	g := &GIF{Image: []*image.Paletted{pm}, Delay: []int{0}, Disposal: []byte{DisposalNone}, Interlace: true}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	want, err := gif.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("standard library failed to decode our interlaced GIF: %v", err)
+	}
+	wantPaletted, ok := want.(*image.Paletted)
+	if !ok {
+		t.Fatalf("decoded image is %T, want *image.Paletted", want)
+	}
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 10; x++ {
+			if got, want := wantPaletted.ColorIndexAt(x, y), pm.ColorIndexAt(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	decoded, err := DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("DecodeAll failed on interlaced GIF: %v", err)
+	}
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 10; x++ {
+			if got, want := decoded.Image[0].ColorIndexAt(x, y), pm.ColorIndexAt(x, y); got != want {
+				t.Fatalf("our decoder pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
 func BenchmarkStandardLibrary(b *testing.B) {
 	pngFile, err := os.Open("test.png")
 	if err != nil {
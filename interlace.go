@@ -0,0 +1,19 @@
+package gip
+
+// interlacePasses returns, for an image height rows tall, the four GIF
+// interlace passes in transmission order: rows 0 step 8, 4 step 8, 2
+// step 4, and 1 step 2. It is shared by the decoder (to put decoded
+// scanlines back in top-to-bottom order) and the encoder's interlaced
+// output mode (to feed the LZW encoder scanlines in transmission order).
+func interlacePasses(height int) [][]int {
+	starts := [4]int{0, 4, 2, 1}
+	steps := [4]int{8, 8, 4, 2}
+
+	passes := make([][]int, 4)
+	for p := 0; p < 4; p++ {
+		for y := starts[p]; y < height; y += steps[p] {
+			passes[p] = append(passes[p], y)
+		}
+	}
+	return passes
+}
@@ -0,0 +1,133 @@
+package gip
+
+// lzwEncoder is an in-package, LSB-first, variable-code-width (2..12 bit)
+// LZW encoder matching the GIF image data sub-format: codes start at
+// litWidth+1 bits, code 1<<litWidth is the clear code, the next code is
+// EOI, and the table is cleared (with a clear code emitted into the
+// stream) once it fills rather than growing past 12 bits. Its bit-level
+// state lives entirely in the struct, so in principle strips could be
+// encoded independently and stitched later; writeLZWData instead runs
+// one encoder over the whole image so the output is always a single
+// valid stream, per the GIF spec.
+type lzwEncoder struct {
+	litWidth  int
+	clearCode uint32
+	eoiCode   uint32
+	nextCode  uint32
+	codeWidth uint
+	maxCode   uint32
+	table     map[uint64]uint32
+
+	curCode uint32
+	hasCur  bool
+	started bool
+
+	bw       *blockWriter
+	bitBuf   uint64
+	bitCount uint
+}
+
+func newLZWEncoder(bw *blockWriter, litWidth int) *lzwEncoder {
+	e := &lzwEncoder{litWidth: litWidth, bw: bw}
+	e.resetTable()
+	return e
+}
+
+func (e *lzwEncoder) resetTable() {
+	e.clearCode = 1 << uint(e.litWidth)
+	e.eoiCode = e.clearCode + 1
+	e.nextCode = e.clearCode + 2
+	e.codeWidth = uint(e.litWidth) + 1
+	e.maxCode = 1 << e.codeWidth
+	e.table = make(map[uint64]uint32)
+}
+
+func (e *lzwEncoder) writeCode(code uint32) error {
+	e.bitBuf |= uint64(code) << e.bitCount
+	e.bitCount += e.codeWidth
+	for e.bitCount >= 8 {
+		if _, err := e.bw.Write([]byte{byte(e.bitBuf)}); err != nil {
+			return err
+		}
+		e.bitBuf >>= 8
+		e.bitCount -= 8
+	}
+	return nil
+}
+
+// Write compresses p, which must be a sequence of palette indices, and
+// may be called multiple times to feed the encoder incrementally.
+func (e *lzwEncoder) Write(p []byte) error {
+	if !e.started {
+		if err := e.writeCode(e.clearCode); err != nil {
+			return err
+		}
+		e.started = true
+	}
+
+	for _, c := range p {
+		if !e.hasCur {
+			e.curCode = uint32(c)
+			e.hasCur = true
+			continue
+		}
+
+		key := uint64(e.curCode)<<8 | uint64(c)
+		if next, ok := e.table[key]; ok {
+			e.curCode = next
+			continue
+		}
+
+		if err := e.writeCode(e.curCode); err != nil {
+			return err
+		}
+
+		if e.nextCode < 4096 {
+			e.table[key] = e.nextCode
+			e.nextCode++
+			if e.nextCode > e.maxCode && e.codeWidth < 12 {
+				e.codeWidth++
+				e.maxCode = 1 << e.codeWidth
+			}
+		} else {
+			if err := e.writeCode(e.clearCode); err != nil {
+				return err
+			}
+			e.resetTable()
+		}
+
+		e.curCode = uint32(c)
+	}
+	return nil
+}
+
+// Close flushes the final code, the EOI code, and any partial byte, then
+// closes the underlying blockWriter.
+func (e *lzwEncoder) Close() error {
+	if !e.started {
+		if err := e.writeCode(e.clearCode); err != nil {
+			return err
+		}
+		e.started = true
+	}
+	if e.hasCur {
+		if err := e.writeCode(e.curCode); err != nil {
+			return err
+		}
+	}
+	if err := e.writeCode(e.eoiCode); err != nil {
+		return err
+	}
+	for e.bitCount > 0 {
+		if _, err := e.bw.Write([]byte{byte(e.bitBuf)}); err != nil {
+			return err
+		}
+		e.bitBuf >>= 8
+		if e.bitCount >= 8 {
+			e.bitCount -= 8
+		} else {
+			e.bitCount = 0
+		}
+	}
+	return e.bw.close()
+}
@@ -0,0 +1,191 @@
+package gip
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// MedianCutQuantizer builds a palette of up to 256 colors from an image by
+// recursively splitting a histogram of its colors into boxes along their
+// longest color axis, using each box's centroid as a palette entry. It
+// implements golang.org/x/image/draw.Quantizer, so it can be assigned to
+// Options.Quantizer directly, or used standalone as a reasonable default
+// quantizer without pulling in extra dependencies.
+type MedianCutQuantizer struct{}
+
+type medianCutColor struct {
+	r, g, b uint8
+	count   uint32
+}
+
+type colorBox struct {
+	colors []medianCutColor
+}
+
+// Quantize appends up to 256 colors summarizing m to p and returns the
+// result.
+func (MedianCutQuantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	hist := buildHistogram(m)
+	if len(hist) == 0 {
+		return p
+	}
+
+	boxes := []colorBox{{colors: hist}}
+	for len(boxes) < 256 {
+		idx, ok := widestBox(boxes)
+		if !ok {
+			break
+		}
+		a, b := boxes[idx].split()
+		if len(a.colors) == 0 || len(b.colors) == 0 {
+			break
+		}
+		rest := append([]colorBox{a, b}, boxes[idx+1:]...)
+		boxes = append(boxes[:idx], rest...)
+	}
+
+	for _, box := range boxes {
+		p = append(p, box.average())
+	}
+	return p
+}
+
+// buildHistogram tallies m's colors, splitting the work by row across
+// workers and merging the per-worker histograms at the end.
+func buildHistogram(m image.Image) []medianCutColor {
+	b := m.Bounds()
+	workers := runtime.NumCPU()
+	height := b.Dy()
+	rowsPerWorker := height / workers
+	if rowsPerWorker < 1 {
+		rowsPerWorker = 1
+		workers = height
+	}
+
+	partials := make([]map[[3]uint8]uint32, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		startY := b.Min.Y + i*rowsPerWorker
+		endY := startY + rowsPerWorker
+		if i == workers-1 {
+			endY = b.Max.Y
+		}
+		partials[i] = make(map[[3]uint8]uint32)
+
+		wg.Add(1)
+		go func(i, sy, ey int) {
+			defer wg.Done()
+			hist := partials[i]
+			for y := sy; y < ey; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					r, g, bl, _ := m.At(x, y).RGBA()
+					key := [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8)}
+					hist[key]++
+				}
+			}
+		}(i, startY, endY)
+	}
+	wg.Wait()
+
+	merged := make(map[[3]uint8]uint32)
+	for _, hist := range partials {
+		for k, c := range hist {
+			merged[k] += c
+		}
+	}
+
+	colors := make([]medianCutColor, 0, len(merged))
+	for k, c := range merged {
+		colors = append(colors, medianCutColor{k[0], k[1], k[2], c})
+	}
+	return colors
+}
+
+func widestBox(boxes []colorBox) (int, bool) {
+	best := -1
+	var bestRange uint8
+	for i, box := range boxes {
+		if len(box.colors) < 2 {
+			continue
+		}
+		if _, rng := box.longestAxis(); best == -1 || rng > bestRange {
+			best, bestRange = i, rng
+		}
+	}
+	return best, best != -1
+}
+
+func (box colorBox) longestAxis() (axis int, rng uint8) {
+	minR, maxR := uint8(255), uint8(0)
+	minG, maxG := uint8(255), uint8(0)
+	minB, maxB := uint8(255), uint8(0)
+	for _, c := range box.colors {
+		if c.r < minR {
+			minR = c.r
+		}
+		if c.r > maxR {
+			maxR = c.r
+		}
+		if c.g < minG {
+			minG = c.g
+		}
+		if c.g > maxG {
+			maxG = c.g
+		}
+		if c.b < minB {
+			minB = c.b
+		}
+		if c.b > maxB {
+			maxB = c.b
+		}
+	}
+
+	axis, rng = 0, maxR-minR
+	if g := maxG - minG; g > rng {
+		axis, rng = 1, g
+	}
+	if bl := maxB - minB; bl > rng {
+		axis, rng = 2, bl
+	}
+	return axis, rng
+}
+
+func (box colorBox) split() (colorBox, colorBox) {
+	axis, _ := box.longestAxis()
+	sort.Slice(box.colors, func(i, j int) bool {
+		switch axis {
+		case 0:
+			return box.colors[i].r < box.colors[j].r
+		case 1:
+			return box.colors[i].g < box.colors[j].g
+		default:
+			return box.colors[i].b < box.colors[j].b
+		}
+	})
+
+	mid := len(box.colors) / 2
+	return colorBox{colors: box.colors[:mid]}, colorBox{colors: box.colors[mid:]}
+}
+
+func (box colorBox) average() color.Color {
+	var rSum, gSum, bSum, total uint64
+	for _, c := range box.colors {
+		w := uint64(c.count)
+		rSum += uint64(c.r) * w
+		gSum += uint64(c.g) * w
+		bSum += uint64(c.b) * w
+		total += w
+	}
+	if total == 0 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{
+		R: uint8(rSum / total),
+		G: uint8(gSum / total),
+		B: uint8(bSum / total),
+		A: 255,
+	}
+}
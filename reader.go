@@ -0,0 +1,418 @@
+package gip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/lzw"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// decoder holds the state needed to parse a GIF stream's header and
+// logical screen descriptor, shared by Decode, DecodeAll and
+// DecodeConfig.
+type decoder struct {
+	r               *bufio.Reader
+	width, height   int
+	globalPalette   color.Palette
+	backgroundIndex uint8
+}
+
+// Decode reads a GIF image from r and returns the first frame, mirroring
+// image/gif.Decode.
+func Decode(r io.Reader) (image.Image, error) {
+	g, err := DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return g.Image[0], nil
+}
+
+// DecodeConfig returns the color model and dimensions of a GIF image
+// without decoding any of its frames, mirroring image/gif.DecodeConfig.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeaderAndScreen(); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: d.globalPalette,
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
+
+// rawFrame is a frame's still-compressed data as found on the wire,
+// ready to be handed to a decode worker.
+type rawFrame struct {
+	data        []byte
+	litWidth    int
+	palette     color.Palette
+	rect        image.Rectangle
+	interlace   bool
+	disposal    byte
+	delay       int
+	transparent int // -1 if the frame has no transparent index
+}
+
+// DecodeAll reads a GIF image from r and returns its frames and timing
+// information, mirroring image/gif.DecodeAll. A single goroutine demuxes
+// the sub-blocks of each frame in turn (decoding a GIF is inherently
+// sequential up to that point); the LZW decode and de-interlace of each
+// frame then runs on a worker pool, bounded by runtime.NumCPU(), so
+// multi-frame animated GIFs decode across cores. Frames are returned at
+// their own image-descriptor rects and are not composited onto a canvas;
+// disposal methods are reported in Disposal but not applied.
+func DecodeAll(r io.Reader) (*GIF, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeaderAndScreen(); err != nil {
+		return nil, err
+	}
+
+	var raws []rawFrame
+	loopCount := 0
+
+	var pendingDisposal byte
+	pendingDelay := 0
+	pendingTransparent := -1
+
+	for {
+		label, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch label {
+		case 0x21: // extension introducer
+			extType, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			switch extType {
+			case 0xF9: // graphic control extension
+				block, err := d.readSubBlock()
+				if err != nil {
+					return nil, err
+				}
+				if len(block) < 4 {
+					return nil, errors.New("gif: invalid graphic control extension")
+				}
+				packed := block[0]
+				pendingDisposal = (packed >> 2) & 0x07
+				pendingDelay = int(binary.LittleEndian.Uint16(block[1:3]))
+				pendingTransparent = -1
+				if packed&0x01 != 0 {
+					pendingTransparent = int(block[3])
+				}
+				if err := d.skipSubBlocks(); err != nil {
+					return nil, err
+				}
+			case 0xFF: // application extension
+				block, err := d.readSubBlock()
+				if err != nil {
+					return nil, err
+				}
+				if string(block) == "NETSCAPE2.0" {
+					data, err := d.readSubBlock()
+					if err != nil {
+						return nil, err
+					}
+					if len(data) >= 3 && data[0] == 0x01 {
+						loopCount = int(binary.LittleEndian.Uint16(data[1:3]))
+					}
+				}
+				if err := d.skipSubBlocks(); err != nil {
+					return nil, err
+				}
+			default: // comment, plain text, or anything we don't special-case
+				if err := d.skipSubBlocks(); err != nil {
+					return nil, err
+				}
+			}
+
+		case 0x2C: // image descriptor
+			rect, localPalette, interlace, err := d.readImageDescriptor()
+			if err != nil {
+				return nil, err
+			}
+			litWidth, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			data, err := d.readAllSubBlocks()
+			if err != nil {
+				return nil, err
+			}
+
+			pal := localPalette
+			if pal == nil {
+				pal = d.globalPalette
+			}
+			if len(pal) == 0 {
+				return nil, errors.New("gif: no color table available for image")
+			}
+
+			raws = append(raws, rawFrame{
+				data:        data,
+				litWidth:    int(litWidth),
+				palette:     pal,
+				rect:        rect,
+				interlace:   interlace,
+				disposal:    pendingDisposal,
+				delay:       pendingDelay,
+				transparent: pendingTransparent,
+			})
+			pendingDisposal, pendingDelay, pendingTransparent = 0, 0, -1
+
+		case 0x3B: // trailer
+			return d.assembleGIF(raws, loopCount)
+
+		default:
+			return nil, errors.New("gif: unknown block type")
+		}
+	}
+}
+
+// assembleGIF LZW-decodes every frame concurrently and returns each frame
+// at its own declared image-descriptor rect, mirroring image/gif.GIF.Image:
+// each entry is that frame's own decoded pixels, not a canvas composited
+// with earlier frames per the disposal method. Callers that want the fully
+// rendered canvas for a frame composite it themselves using Disposal, the
+// same way callers of image/gif do.
+func (d *decoder) assembleGIF(raws []rawFrame, loopCount int) (*GIF, error) {
+	if len(raws) == 0 {
+		return nil, errors.New("gif: no images found")
+	}
+
+	decodedFrames, err := decodeFramesParallel(raws)
+	if err != nil {
+		return nil, err
+	}
+
+	canvasPalette := d.globalPalette
+	if canvasPalette == nil {
+		canvasPalette = raws[0].palette
+	}
+
+	images := make([]*image.Paletted, len(raws))
+	delays := make([]int, len(raws))
+	disposals := make([]byte, len(raws))
+
+	for i, rf := range raws {
+		pm := decodedFrames[i]
+		if rf.transparent >= 0 && rf.transparent < len(pm.Palette) {
+			pal := make(color.Palette, len(pm.Palette))
+			copy(pal, pm.Palette)
+			pal[rf.transparent] = color.RGBA{}
+			pm.Palette = pal
+		}
+
+		images[i] = pm
+		delays[i] = rf.delay
+		disposals[i] = rf.disposal
+	}
+
+	return &GIF{
+		Image:           images,
+		Delay:           delays,
+		Disposal:        disposals,
+		LoopCount:       loopCount,
+		BackgroundIndex: d.backgroundIndex,
+		Config: image.Config{
+			ColorModel: canvasPalette,
+			Width:      d.width,
+			Height:     d.height,
+		},
+	}, nil
+}
+
+func decodeFramesParallel(raws []rawFrame) ([]*image.Paletted, error) {
+	type result struct {
+		idx int
+		pm  *image.Paletted
+		err error
+	}
+
+	workers := runtime.NumCPU()
+	sem := make(chan struct{}, workers)
+	results := make(chan result, len(raws))
+	var wg sync.WaitGroup
+
+	for i, rf := range raws {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, rf rawFrame) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			pm, err := decodeFrame(rf)
+			results <- result{i, pm, err}
+		}(i, rf)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	frames := make([]*image.Paletted, len(raws))
+	var firstErr error
+	for r := range results {
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+		frames[r.idx] = r.pm
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return frames, nil
+}
+
+// decodeFrame LZW-decodes a single frame's pixel data and, if the frame
+// was interlaced, reorders its scanlines back to top-to-bottom order.
+func decodeFrame(rf rawFrame) (*image.Paletted, error) {
+	lr := lzw.NewReader(bytes.NewReader(rf.data), lzw.LSB, rf.litWidth)
+	defer lr.Close()
+
+	dx, dy := rf.rect.Dx(), rf.rect.Dy()
+	raw := make([]byte, dx*dy)
+	if _, err := io.ReadFull(lr, raw); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	pm := image.NewPaletted(rf.rect, rf.palette)
+	if !rf.interlace {
+		copy(pm.Pix, raw)
+		return pm, nil
+	}
+
+	srcRow := 0
+	for _, pass := range interlacePasses(dy) {
+		for _, y := range pass {
+			copy(pm.Pix[y*dx:(y+1)*dx], raw[srcRow*dx:(srcRow+1)*dx])
+			srcRow++
+		}
+	}
+	return pm, nil
+}
+
+func (d *decoder) readHeaderAndScreen() error {
+	var hdr [6]byte
+	if _, err := io.ReadFull(d.r, hdr[:]); err != nil {
+		return err
+	}
+	if string(hdr[:3]) != "GIF" || (string(hdr[3:]) != "87a" && string(hdr[3:]) != "89a") {
+		return errors.New("gif: not a GIF file")
+	}
+
+	var lsd [7]byte
+	if _, err := io.ReadFull(d.r, lsd[:]); err != nil {
+		return err
+	}
+	d.width = int(binary.LittleEndian.Uint16(lsd[0:2]))
+	d.height = int(binary.LittleEndian.Uint16(lsd[2:4]))
+	packed := lsd[4]
+	d.backgroundIndex = lsd[5]
+
+	if packed&0x80 != 0 {
+		size := 2 << uint(packed&0x07)
+		pal, err := readColorTable(d.r, size)
+		if err != nil {
+			return err
+		}
+		d.globalPalette = pal
+	}
+	return nil
+}
+
+func (d *decoder) readImageDescriptor() (image.Rectangle, color.Palette, bool, error) {
+	var desc [9]byte
+	if _, err := io.ReadFull(d.r, desc[:]); err != nil {
+		return image.Rectangle{}, nil, false, err
+	}
+
+	left := int(binary.LittleEndian.Uint16(desc[0:2]))
+	top := int(binary.LittleEndian.Uint16(desc[2:4]))
+	w := int(binary.LittleEndian.Uint16(desc[4:6]))
+	h := int(binary.LittleEndian.Uint16(desc[6:8]))
+	packed := desc[8]
+	interlace := packed&0x40 != 0
+
+	var pal color.Palette
+	if packed&0x80 != 0 {
+		size := 2 << uint(packed&0x07)
+		p, err := readColorTable(d.r, size)
+		if err != nil {
+			return image.Rectangle{}, nil, false, err
+		}
+		pal = p
+	}
+
+	return image.Rect(left, top, left+w, top+h), pal, interlace, nil
+}
+
+func readColorTable(r io.Reader, size int) (color.Palette, error) {
+	pal := make(color.Palette, size)
+	var rgb [3]byte
+	for i := 0; i < size; i++ {
+		if _, err := io.ReadFull(r, rgb[:]); err != nil {
+			return nil, err
+		}
+		pal[i] = color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}
+	}
+	return pal, nil
+}
+
+// readSubBlock reads a single length-prefixed sub-block, or nil at the
+// block terminator.
+func (d *decoder) readSubBlock() ([]byte, error) {
+	size, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readAllSubBlocks reads sub-blocks up to and including the terminator,
+// concatenating their payloads.
+func (d *decoder) readAllSubBlocks() ([]byte, error) {
+	var all []byte
+	for {
+		buf, err := d.readSubBlock()
+		if err != nil {
+			return nil, err
+		}
+		if buf == nil {
+			return all, nil
+		}
+		all = append(all, buf...)
+	}
+}
+
+// skipSubBlocks discards sub-blocks up to and including the terminator.
+func (d *decoder) skipSubBlocks() error {
+	for {
+		size, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := d.r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
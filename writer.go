@@ -0,0 +1,803 @@
+package gip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"io"
+	"runtime"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+var FastGifLut = [256]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+
+// Disposal methods, stored in the Graphic Control Extension that precedes
+// each image descriptor, telling a decoder what to do with a frame's
+// pixels before rendering the next one.
+const (
+	DisposalNone       = 0x01
+	DisposalBackground = 0x02
+	DisposalPrevious   = 0x03
+)
+
+type Options struct {
+	Workers int
+
+	// Quantizer, when set, is run over the source image to build a
+	// palette of up to 256 colors, replacing the default 6x6x6 web-safe
+	// LUT. MedianCutQuantizer is a good default if the caller doesn't
+	// want to pull in golang.org/x/image/draw's own quantizers.
+	Quantizer draw.Quantizer
+
+	// Drawer, when set, renders the source image into the resulting
+	// *image.Paletted, replacing the default per-pixel LUT lookup.
+	// draw.FloydSteinberg (error diffusion) and draw.Src (nearest color,
+	// no dithering) both work.
+	Drawer draw.Drawer
+
+	// Palette, when set without a Quantizer, is used as the output
+	// palette and colors are mapped to their nearest entry in it.
+	Palette color.Palette
+
+	// Transparent, when set, is the palette index treated as transparent.
+	// Source pixels with alpha < 0xff are mapped to this index and a
+	// Graphic Control Extension with the transparent-color flag set is
+	// emitted before the image descriptor.
+	Transparent *uint8
+
+	// Interlace, when true, stores the image in the four-pass interlaced
+	// scanline order defined by the GIF spec, letting decoders render a
+	// low-resolution preview before the full image has arrived.
+	Interlace bool
+}
+
+// GIF represents the possibly multiple images stored in a GIF file, as
+// accepted by EncodeAll. It mirrors image/gif.GIF so that callers already
+// familiar with the standard library feel at home.
+type GIF struct {
+	Image []*image.Paletted
+
+	// Delay holds the delay before each frame, in hundredths of a second.
+	Delay []int
+
+	// Disposal holds the disposal method for each frame, one of the
+	// Disposal* constants.
+	Disposal []byte
+
+	// LoopCount controls the number of times an animation will be
+	// restarted during display. A LoopCount of 0 means to loop forever.
+	LoopCount int
+
+	// BackgroundIndex is the background index in the first frame's palette.
+	BackgroundIndex uint8
+
+	// Config, if non-zero, overrides the logical screen dimensions that
+	// would otherwise be derived from the union of all frame bounds.
+	Config image.Config
+
+	// Transparent, if non-nil, is the palette index treated as
+	// transparent in every frame. For more than one frame, when every
+	// frame shares the first frame's palette, setting it also enables
+	// encoding only the minimal bounding rectangle of
+	// pixels that changed since the previous frame's post-disposal
+	// canvas state, with unchanged pixels mapped to this index — the
+	// trick well-formed screencast GIFs use to stay small.
+	Transparent *uint8
+
+	// Interlace, when true, stores every frame in the four-pass
+	// interlaced scanline order defined by the GIF spec.
+	Interlace bool
+}
+
+func Encode(w io.Writer, m image.Image, o *Options) error {
+	workers := runtime.NumCPU()
+	var quantizer draw.Quantizer
+	var drawer draw.Drawer
+	pal := color.Palette(palette.WebSafe)
+	customPalette := false
+	if o != nil {
+		if o.Workers > 0 {
+			workers = o.Workers
+		}
+		quantizer = o.Quantizer
+		drawer = o.Drawer
+		if o.Palette != nil {
+			pal = o.Palette
+			customPalette = true
+		}
+	}
+
+	b := m.Bounds()
+	if b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return errors.New("gif: image is too large to encode")
+	}
+
+	if quantizer != nil {
+		pal = quantizer.Quantize(make(color.Palette, 0, 256), m)
+		customPalette = true
+	}
+
+	pm := image.NewPaletted(b, pal)
+	switch {
+	case drawer != nil:
+		drawer.Draw(pm, b, m, b.Min)
+	case customPalette:
+		mapColorsToPalette(pm, m, pal, workers)
+	default:
+		mapColors(pm, m, workers)
+	}
+
+	var transparent *uint8
+	if o != nil && o.Transparent != nil {
+		transparent = o.Transparent
+		applyTransparency(pm, m, *transparent, workers)
+	}
+
+	if pm.Rect.Min != (image.Point{}) {
+		dup := *pm
+		dup.Rect = dup.Rect.Sub(dup.Rect.Min)
+		pm = &dup
+	}
+
+	interlace := o != nil && o.Interlace
+
+	return encodeAll(w, &GIF{
+		Image:       []*image.Paletted{pm},
+		Delay:       []int{0},
+		Disposal:    []byte{DisposalNone},
+		Transparent: transparent,
+		Interlace:   interlace,
+	}, workers)
+}
+
+// applyTransparency maps every source pixel with alpha < 0xff to idx in
+// pm, so the caller's Graphic Control Extension's transparent index
+// takes over when the frame is displayed.
+func applyTransparency(pm *image.Paletted, m image.Image, idx uint8, workers int) {
+	b := m.Bounds()
+	height := b.Dy()
+	rowsPerWorker := height / workers
+	if rowsPerWorker < 1 {
+		rowsPerWorker = 1
+		workers = height
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		startY := b.Min.Y + i*rowsPerWorker
+		endY := startY + rowsPerWorker
+		if i == workers-1 {
+			endY = b.Max.Y
+		}
+
+		wg.Add(1)
+		go func(sy, ey int) {
+			defer wg.Done()
+			for y := sy; y < ey; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if _, _, _, a := m.At(x, y).RGBA(); a < 0xffff {
+						pm.SetColorIndex(x, y, idx)
+					}
+				}
+			}
+		}(startY, endY)
+	}
+	wg.Wait()
+}
+
+// EncodeAll writes the images in g to w in GIF format. It emits a
+// NETSCAPE2.0 application extension carrying the loop count and a
+// Graphic Control Extension before each image descriptor. Frames whose
+// palette differs from the first frame's get their own local color
+// table. The frames are already paletted, so no quantization is done;
+// animated frames are LZW-compressed in a pipeline so multiple frames
+// can be processed concurrently on multi-core machines.
+func EncodeAll(w io.Writer, g *GIF) error {
+	return encodeAll(w, g, runtime.NumCPU())
+}
+
+func encodeAll(w io.Writer, g *GIF, workers int) error {
+	if len(g.Image) == 0 {
+		return errors.New("gif: must provide at least one image")
+	}
+	if len(g.Delay) != len(g.Image) {
+		return errors.New("gif: mismatched image and delay lengths")
+	}
+
+	global := g.Image[0].Palette
+	if len(global) == 0 {
+		return errors.New("gif: cannot encode image block with empty palette")
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 && height == 0 {
+		width, height = frameScreenSize(g.Image)
+	}
+	if width >= 1<<16 || height >= 1<<16 {
+		return errors.New("gif: image is too large to encode")
+	}
+
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("GIF89a")
+	writeUint16(bw, uint16(width))
+	writeUint16(bw, uint16(height))
+
+	paddedSize := paddedPaletteSize(len(global))
+	if g.Transparent != nil {
+		for paddedSize <= int(*g.Transparent) && paddedSize < 256 {
+			paddedSize <<= 1
+		}
+	}
+	bw.WriteByte(0x80 | uint8(log2(paddedSize)))
+	bw.WriteByte(g.BackgroundIndex)
+	bw.WriteByte(0x00)
+	writeColorTable(bw, global, paddedSize)
+
+	specs := buildFrameSpecs(g)
+
+	animated := len(specs) > 1
+	if animated {
+		if err := writeNetscapeExt(bw, g.LoopCount); err != nil {
+			return err
+		}
+		frames, err := encodeFrameSpecsParallel(specs, global, g.Transparent, g.Interlace, workers)
+		if err != nil {
+			return err
+		}
+		for _, f := range frames {
+			if _, err := bw.Write(f); err != nil {
+				return err
+			}
+		}
+	} else {
+		spec := specs[0]
+		if err := encodeFrame(bw, spec.pm, global, spec.disposal, spec.delay, workers, g.Transparent, g.Interlace); err != nil {
+			return err
+		}
+	}
+
+	bw.WriteByte(0x3B)
+	return bw.Flush()
+}
+
+// frameSpec is the fully-resolved description of a frame ready to be
+// encoded: its pixels (already cropped to the changed rect when the
+// transparency diff optimization applies), disposal method and delay.
+type frameSpec struct {
+	pm       *image.Paletted
+	disposal byte
+	delay    int
+}
+
+func disposalFor(g *GIF, i int) byte {
+	if i < len(g.Disposal) {
+		return g.Disposal[i]
+	}
+	return 0
+}
+
+// buildFrameSpecs resolves each frame's disposal and delay, and, when
+// g.Transparent is set and there is more than one frame sharing a single
+// palette, crops each frame after the first to the minimal bounding
+// rectangle that changed since the previous frame's post-disposal
+// canvas state, mapping unchanged pixels within that rectangle to the
+// transparent index.
+func buildFrameSpecs(g *GIF) []frameSpec {
+	specs := make([]frameSpec, len(g.Image))
+	for i, pm := range g.Image {
+		specs[i] = frameSpec{pm, disposalFor(g, i), g.Delay[i]}
+	}
+
+	if g.Transparent == nil || len(g.Image) < 2 {
+		return specs
+	}
+
+	global := g.Image[0].Palette
+	for _, pm := range g.Image {
+		if !paletteEqual(pm.Palette, global) {
+			return specs
+		}
+	}
+
+	transparent := *g.Transparent
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 && height == 0 {
+		width, height = frameScreenSize(g.Image)
+	}
+
+	canvas := image.NewPaletted(image.Rect(0, 0, width, height), global)
+	copyIntoCanvas(canvas, g.Image[0])
+	beforeFrame := clonePaletted(canvas)
+
+	for i := 1; i < len(g.Image); i++ {
+		var postDisposal *image.Paletted
+		switch specs[i-1].disposal {
+		case DisposalPrevious:
+			postDisposal = beforeFrame
+		case DisposalBackground:
+			postDisposal = nil
+		default:
+			postDisposal = canvas
+		}
+
+		specs[i].pm = cropWithTransparency(g.Image[i], postDisposal, transparent)
+
+		beforeFrame = clonePaletted(canvas)
+		copyIntoCanvas(canvas, g.Image[i])
+	}
+
+	return specs
+}
+
+// cropWithTransparency returns the minimal bounding rectangle of pixels
+// in frame that differ from prevCanvas, with unchanged pixels inside
+// that rectangle mapped to transparent. prevCanvas == nil means the
+// previous state is unknown (e.g. DisposalBackground), so frame is
+// returned unchanged.
+func cropWithTransparency(frame, prevCanvas *image.Paletted, transparent uint8) *image.Paletted {
+	if prevCanvas == nil {
+		return frame
+	}
+
+	b := frame.Bounds()
+	minX, minY := b.Max.X, b.Max.Y
+	maxX, maxY := b.Min.X, b.Min.Y
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if frame.ColorIndexAt(x, y) != prevCanvas.ColorIndexAt(x, y) {
+				if x < minX {
+					minX = x
+				}
+				if x+1 > maxX {
+					maxX = x + 1
+				}
+				if y < minY {
+					minY = y
+				}
+				if y+1 > maxY {
+					maxY = y + 1
+				}
+			}
+		}
+	}
+	if minX >= maxX || minY >= maxY {
+		minX, minY, maxX, maxY = b.Min.X, b.Min.Y, b.Min.X+1, b.Min.Y+1
+	}
+
+	rect := image.Rect(minX, minY, maxX, maxY)
+	sub := image.NewPaletted(rect, frame.Palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			idx := frame.ColorIndexAt(x, y)
+			if idx == prevCanvas.ColorIndexAt(x, y) {
+				idx = transparent
+			}
+			sub.SetColorIndex(x, y, idx)
+		}
+	}
+	return sub
+}
+
+func copyIntoCanvas(canvas, frame *image.Paletted) {
+	b := frame.Bounds().Intersect(canvas.Bounds())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			canvas.SetColorIndex(x, y, frame.ColorIndexAt(x, y))
+		}
+	}
+}
+
+func clonePaletted(src *image.Paletted) *image.Paletted {
+	dup := image.NewPaletted(src.Bounds(), src.Palette)
+	copy(dup.Pix, src.Pix)
+	return dup
+}
+
+// encodeFrameSpecsParallel encodes each frame (Graphic Control Extension,
+// image descriptor and LZW data) on its own goroutine, bounded to
+// workers concurrent frames, and returns the encoded frames in order.
+func encodeFrameSpecsParallel(specs []frameSpec, global color.Palette, transparent *uint8, interlace bool, workers int) ([][]byte, error) {
+	type result struct {
+		idx int
+		buf []byte
+		err error
+	}
+
+	sem := make(chan struct{}, workers)
+	results := make(chan result, len(specs))
+	var wg sync.WaitGroup
+
+	for i, spec := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, spec frameSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var buf bytes.Buffer
+			err := encodeFrame(&buf, spec.pm, global, spec.disposal, spec.delay, 1, transparent, interlace)
+			results <- result{i, buf.Bytes(), err}
+		}(i, spec)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	frames := make([][]byte, len(specs))
+	var firstErr error
+	for r := range results {
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+		frames[r.idx] = r.buf
+	}
+	return frames, firstErr
+}
+
+// encodeFrame writes a single frame's Graphic Control Extension, image
+// descriptor and LZW-compressed pixel data to w. A local color table is
+// emitted when the frame's palette differs from the global one.
+func encodeFrame(w io.Writer, pm *image.Paletted, global color.Palette, disposal byte, delay int, workers int, transparent *uint8, interlace bool) error {
+	if len(pm.Palette) == 0 {
+		return errors.New("gif: cannot encode image block with empty palette")
+	}
+
+	if err := writeGraphicControlExtension(w, disposal, delay, transparent); err != nil {
+		return err
+	}
+
+	b := pm.Bounds()
+	local := !paletteEqual(pm.Palette, global)
+	// The transparent index may lie past the palette's last entry; the
+	// color table and the LZW literal width must still cover it.
+	tableLen := len(pm.Palette)
+	if transparent != nil && int(*transparent) >= tableLen {
+		tableLen = int(*transparent) + 1
+	}
+	paddedSize := paddedPaletteSize(tableLen)
+
+	if _, err := w.Write([]byte{0x2C}); err != nil {
+		return err
+	}
+	writeUint16(w, uint16(b.Min.X))
+	writeUint16(w, uint16(b.Min.Y))
+	writeUint16(w, uint16(b.Dx()))
+	writeUint16(w, uint16(b.Dy()))
+
+	packed := byte(0)
+	if local {
+		packed = 0x80 | uint8(log2(paddedSize))
+	}
+	if interlace {
+		packed |= 0x40
+	}
+	if _, err := w.Write([]byte{packed}); err != nil {
+		return err
+	}
+	if local {
+		if err := writeColorTable(w, pm.Palette, paddedSize); err != nil {
+			return err
+		}
+	}
+
+	litWidth := litWidthFor(tableLen)
+	if _, err := w.Write([]byte{uint8(litWidth)}); err != nil {
+		return err
+	}
+
+	return writeLZWData(w, pm, litWidth, workers, interlace)
+}
+
+// writeNetscapeExt writes the NETSCAPE2.0 application extension used by
+// all major decoders to determine an animation's loop count.
+func writeNetscapeExt(w io.Writer, loopCount int) error {
+	if _, err := w.Write([]byte{0x21, 0xFF, 0x0B}); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "NETSCAPE2.0"); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0x03, 0x01}); err != nil {
+		return err
+	}
+	if err := writeUint16(w, uint16(loopCount)); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+// writeGraphicControlExtension writes the block (label 0xF9, size 4) that
+// precedes an image descriptor, carrying its disposal method, delay and,
+// when transparent is non-nil, the transparent-color flag and index.
+func writeGraphicControlExtension(w io.Writer, disposal byte, delay int, transparent *uint8) error {
+	packed := disposal << 2
+	transIndex := byte(0)
+	if transparent != nil {
+		packed |= 0x01
+		transIndex = *transparent
+	}
+	if _, err := w.Write([]byte{0x21, 0xF9, 0x04, packed}); err != nil {
+		return err
+	}
+	if err := writeUint16(w, uint16(delay)); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{transIndex, 0x00})
+	return err
+}
+
+func frameScreenSize(images []*image.Paletted) (int, int) {
+	w, h := 0, 0
+	for _, pm := range images {
+		r := pm.Bounds()
+		if r.Max.X > w {
+			w = r.Max.X
+		}
+		if r.Max.Y > h {
+			h = r.Max.Y
+		}
+	}
+	return w, h
+}
+
+func paletteEqual(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func litWidthFor(paletteLen int) int {
+	if paletteLen == 0 {
+		return 8
+	}
+	litWidth := 2
+	for litWidth < 8 && 1<<uint(litWidth) < paletteLen {
+		litWidth++
+	}
+	return litWidth
+}
+
+func mapColors(pm *image.Paletted, m image.Image, workers int) {
+	b := m.Bounds()
+	height := b.Dy()
+	rowsPerWorker := height / workers
+	if rowsPerWorker < 1 {
+		rowsPerWorker = 1
+		workers = height
+	}
+
+	var wg sync.WaitGroup
+	mapFunc := getColorMapper(m)
+
+	for i := 0; i < workers; i++ {
+		startY := b.Min.Y + i*rowsPerWorker
+		endY := startY + rowsPerWorker
+		if i == workers-1 {
+			endY = b.Max.Y
+		}
+
+		wg.Add(1)
+		go func(sy, ey int) {
+			defer wg.Done()
+			mapFunc(pm, m, b.Min.X, b.Max.X, sy, ey)
+		}(startY, endY)
+	}
+	wg.Wait()
+}
+
+// mapColorsToPalette is the nearest-color equivalent of mapColors for a
+// caller-supplied Palette, used when no Drawer is set but a Quantizer or
+// an explicit Palette opts the caller out of the fast web-safe LUT.
+func mapColorsToPalette(pm *image.Paletted, m image.Image, pal color.Palette, workers int) {
+	b := m.Bounds()
+	height := b.Dy()
+	rowsPerWorker := height / workers
+	if rowsPerWorker < 1 {
+		rowsPerWorker = 1
+		workers = height
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		startY := b.Min.Y + i*rowsPerWorker
+		endY := startY + rowsPerWorker
+		if i == workers-1 {
+			endY = b.Max.Y
+		}
+
+		wg.Add(1)
+		go func(sy, ey int) {
+			defer wg.Done()
+			for y := sy; y < ey; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					idx := pal.Index(m.At(x, y))
+					pm.SetColorIndex(x, y, uint8(idx))
+				}
+			}
+		}(startY, endY)
+	}
+	wg.Wait()
+}
+
+func getColorMapper(m image.Image) func(*image.Paletted, image.Image, int, int, int, int) {
+	if i64, ok := m.(image.RGBA64Image); ok {
+		return func(pm *image.Paletted, _ image.Image, minX, maxX, startY, endY int) {
+			for y := startY; y < endY; y++ {
+				for x := minX; x < maxX; x++ {
+					c := i64.RGBA64At(x, y)
+					idx := 36*FastGifLut[c.R>>8] + 6*FastGifLut[c.G>>8] + FastGifLut[c.B>>8]
+					pm.SetColorIndex(x, y, uint8(idx))
+				}
+			}
+		}
+	}
+	return func(pm *image.Paletted, m image.Image, minX, maxX, startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := minX; x < maxX; x++ {
+				r, g, b, _ := m.At(x, y).RGBA()
+				idx := 36*FastGifLut[(r>>8)&0xff] + 6*FastGifLut[(g>>8)&0xff] + FastGifLut[(b>>8)&0xff]
+				pm.SetColorIndex(x, y, uint8(idx))
+			}
+		}
+	}
+}
+
+// writeLZWData compresses pm's pixels into a single valid LZW stream and
+// writes it to w as GIF sub-blocks. The scanline copy into a contiguous
+// buffer is parallelized across workers, but the LZW codes themselves
+// are emitted by a single lzwEncoder, since independent per-strip
+// compress/lzw.Writers (each starting its own clear code and ending its
+// own EOI) do not concatenate into a spec-compliant stream — a
+// conforming decoder stops at the first EOI it sees.
+func writeLZWData(w io.Writer, pm *image.Paletted, litWidth int, workers int, interlace bool) error {
+	b := pm.Bounds()
+	dx, dy := b.Dx(), b.Dy()
+
+	// rowOrder[i] is the source scanline that belongs at output position
+	// i: identity for non-interlaced images, the four GIF interlace
+	// passes concatenated otherwise.
+	rowOrder := make([]int, dy)
+	if interlace {
+		i := 0
+		for _, pass := range interlacePasses(dy) {
+			for _, y := range pass {
+				rowOrder[i] = y
+				i++
+			}
+		}
+	} else {
+		for y := 0; y < dy; y++ {
+			rowOrder[y] = y
+		}
+	}
+
+	stripHeight := dy / workers
+	if stripHeight < 1 {
+		stripHeight = 1
+		workers = dy
+	}
+
+	imageData := make([]byte, dx*dy)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		startY := i * stripHeight
+		endY := startY + stripHeight
+		if i == workers-1 {
+			endY = dy
+		}
+
+		wg.Add(1)
+		go func(sy, ey int) {
+			defer wg.Done()
+			for y := sy; y < ey; y++ {
+				srcY := rowOrder[y]
+				copy(imageData[y*dx:(y+1)*dx], pm.Pix[srcY*pm.Stride:srcY*pm.Stride+dx])
+			}
+		}(startY, endY)
+	}
+	wg.Wait()
+
+	bw := &blockWriter{w: w}
+	e := newLZWEncoder(bw, litWidth)
+
+	if err := e.Write(imageData); err != nil {
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+
+	// Block terminator: a zero-length sub-block marking the end of the
+	// image data, as required after the last LZW sub-block emitted above.
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+type blockWriter struct {
+	w   io.Writer
+	buf [256]byte
+	n   int
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n := copy(b.buf[b.n+1:256], p)
+		b.n += n
+		p = p[n:]
+		total += n
+
+		if b.n == 255 {
+			b.buf[0] = 255
+			if _, err := b.w.Write(b.buf[:256]); err != nil {
+				return total, err
+			}
+			b.n = 0
+		}
+	}
+	return total, nil
+}
+
+func (b *blockWriter) close() error {
+	if b.n > 0 {
+		b.buf[0] = uint8(b.n)
+		_, err := b.w.Write(b.buf[:b.n+1])
+		return err
+	}
+	return nil
+}
+
+func writeUint16(w io.Writer, v uint16) error {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func writeColorTable(w io.Writer, p color.Palette, paddedSize int) error {
+	for i := 0; i < paddedSize; i++ {
+		var rgb [3]byte
+		if i < len(p) {
+			c := color.NRGBAModel.Convert(p[i]).(color.NRGBA)
+			rgb = [3]byte{c.R, c.G, c.B}
+		}
+		if _, err := w.Write(rgb[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func paddedPaletteSize(n int) int {
+	s := 2
+	for s < n && s < 256 {
+		s <<= 1
+	}
+	return s
+}
+
+func log2(x int) int {
+	for i, v := range [8]int{2, 4, 8, 16, 32, 64, 128, 256} {
+		if x <= v {
+			return i
+		}
+	}
+	return -1
+}